@@ -0,0 +1,118 @@
+package slogxfluentbit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// BasicAuth holds HTTP basic authentication credentials for the HTTP transport.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// TokenProviderFunc supplies a rotating bearer token (e.g. for OAuth2/OIDC-style authentication), along with
+// the time at which it expires. The returned token is cached until expiry and refreshed on demand.
+type TokenProviderFunc func(ctx context.Context) (string, time.Time, error)
+
+// applyAuth wires BasicAuth, BearerToken, and TLS settings from opts into client. It is called against both
+// the default resty client the handler constructs and any client supplied by the caller, unless AuthOverride
+// is set.
+func applyAuth(client *resty.Client, opts *FluentBitHandlerOptions) error {
+	if opts.BasicAuth != nil {
+		client.SetBasicAuth(opts.BasicAuth.Username, opts.BasicAuth.Password)
+	}
+	if opts.BearerToken != "" {
+		client.SetAuthToken(opts.BearerToken)
+	}
+
+	tlsConfig, err := buildTLSConfig(opts)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		client.SetTLSClientConfig(tlsConfig)
+	}
+	return nil
+}
+
+// buildTLSConfig merges opts.TLSConfig with the ClientCertFile/ClientKeyFile/CAFile shortcuts, returning nil
+// if none of them are set.
+func buildTLSConfig(opts *FluentBitHandlerOptions) (*tls.Config, error) {
+	if opts.TLSConfig == nil && opts.ClientCertFile == "" && opts.CAFile == "" {
+		return nil, nil
+	}
+
+	var tlsConfig tls.Config
+	if opts.TLSConfig != nil {
+		tlsConfig = *opts.TLSConfig
+	}
+
+	if opts.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+
+	if opts.CAFile != "" {
+		caCert, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA file %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &tlsConfig, nil
+}
+
+// authTokenCache caches a rotating bearer token obtained from a TokenProviderFunc until it expires.
+type authTokenCache struct {
+	mu       sync.Mutex
+	provider TokenProviderFunc
+	token    string
+	expires  time.Time
+}
+
+// newAuthTokenCache creates a cache that fetches tokens from provider.
+func newAuthTokenCache(provider TokenProviderFunc) *authTokenCache {
+	return &authTokenCache{provider: provider}
+}
+
+// get returns the cached token, fetching (and caching) a new one via provider if the cache is empty or has
+// expired.
+func (c *authTokenCache) get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	token, expires, err := c.provider(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expires = expires
+	return c.token, nil
+}
+
+// invalidate clears the cached token, forcing the next get() to fetch a fresh one.
+func (c *authTokenCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+}
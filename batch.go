@@ -0,0 +1,232 @@
+package slogxfluentbit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Compression specifies the compression algorithm applied to outbound batch payloads.
+type Compression string
+
+const (
+	// CompressionNone disables compression of batch payloads.
+	CompressionNone Compression = "none"
+
+	// CompressionGzip gzip-compresses batch payloads and sets the Content-Encoding: gzip header.
+	CompressionGzip Compression = "gzip"
+)
+
+// BatchFormat controls how multiple formatted records are framed within a single batch payload.
+type BatchFormat string
+
+const (
+	// BatchFormatJSONArray wraps the batch as a single JSON array: [record1, record2, ...].
+	BatchFormatJSONArray BatchFormat = "json_array"
+
+	// BatchFormatNDJSON joins records with a newline, one JSON object per line.
+	BatchFormatNDJSON BatchFormat = "ndjson"
+)
+
+// OverflowPolicy controls what happens when the in-memory batch buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowPolicyDropOldest discards the oldest buffered record to make room for the incoming one.
+	OverflowPolicyDropOldest OverflowPolicy = "drop_oldest"
+
+	// OverflowPolicyDropNewest silently discards the record being enqueued, leaving the buffer untouched.
+	OverflowPolicyDropNewest OverflowPolicy = "drop_newest"
+
+	// OverflowPolicyBlockWithTimeout blocks the caller until room is available or OverflowTimeout elapses.
+	OverflowPolicyBlockWithTimeout OverflowPolicy = "block_with_timeout"
+)
+
+// ErrBufferOverflowTimeout is returned by Handle() when OverflowPolicyBlockWithTimeout is in effect and no
+// room became available in the batch buffer before OverflowTimeout elapsed.
+var ErrBufferOverflowTimeout = errors.New("timed out waiting for room in the batch buffer")
+
+// batchPollInterval is how often a blocked enqueue re-checks the buffer for room.
+const batchPollInterval = 10 * time.Millisecond
+
+// batchFlushFunc posts a batch of already-formatted records to the Fluent Bit listener.
+type batchFlushFunc func(ctx context.Context, entries [][]byte) error
+
+// batcher accumulates formatted records in a bounded buffer and flushes them, via flushFn, either when the
+// buffer fills or BatchFlushInterval elapses. A dedicated goroutine owns the buffer and the flush loop so
+// enqueue() never itself performs network I/O.
+type batcher struct {
+	mu       sync.Mutex
+	entries  [][]byte
+	bytes    int
+	closed   bool
+	flushNow chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	flushFn  batchFlushFunc
+	options  *FluentBitHandlerOptions
+}
+
+// newBatcher creates a new batcher that flushes accumulated records using flushFn.
+func newBatcher(opts *FluentBitHandlerOptions, flushFn batchFlushFunc) *batcher {
+	return &batcher{
+		options:  opts,
+		flushFn:  flushFn,
+		flushNow: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// start launches the background flush loop.
+func (b *batcher) start() {
+	go b.loop()
+}
+
+// loop flushes the buffer whenever it fills, BatchFlushInterval elapses, or the batcher is shut down.
+func (b *batcher) loop() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.options.BatchFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = b.flush(context.Background())
+		case <-b.flushNow:
+			_ = b.flush(context.Background())
+		case <-b.done:
+			_ = b.flush(context.Background())
+			return
+		}
+	}
+}
+
+// enqueue adds a formatted record to the buffer, applying the configured OverflowPolicy if the buffer is
+// already full, and returns without waiting for the record to actually be flushed.
+func (b *batcher) enqueue(ctx context.Context, payload []byte) error {
+	deadline := time.Now().Add(b.options.OverflowTimeout)
+
+	for {
+		b.mu.Lock()
+		if !b.fullLocked() {
+			b.entries = append(b.entries, payload)
+			b.bytes += len(payload)
+			shouldFlush := b.fullLocked()
+			b.mu.Unlock()
+
+			if shouldFlush {
+				select {
+				case b.flushNow <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		}
+
+		switch b.options.OverflowPolicy {
+		case OverflowPolicyDropOldest:
+			if len(b.entries) > 0 {
+				b.bytes -= len(b.entries[0])
+				b.entries = b.entries[1:]
+			}
+			b.mu.Unlock()
+		case OverflowPolicyDropNewest:
+			b.mu.Unlock()
+			return nil
+		default: // OverflowPolicyBlockWithTimeout
+			b.mu.Unlock()
+			if !time.Now().Before(deadline) {
+				return ErrBufferOverflowTimeout
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(batchPollInterval):
+			}
+		}
+	}
+}
+
+// fullLocked reports whether the buffer has reached BatchSize entries or MaxBufferBytes bytes. The caller
+// must hold b.mu.
+func (b *batcher) fullLocked() bool {
+	if b.options.BatchSize > 0 && len(b.entries) >= b.options.BatchSize {
+		return true
+	}
+	if b.options.MaxBufferBytes > 0 && b.bytes >= b.options.MaxBufferBytes {
+		return true
+	}
+	return false
+}
+
+// flush hands whatever is currently buffered off to flushFn, clearing the buffer regardless of the outcome.
+func (b *batcher) flush(ctx context.Context) error {
+	b.mu.Lock()
+	if len(b.entries) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	entries := b.entries
+	b.entries = nil
+	b.bytes = 0
+	b.mu.Unlock()
+
+	return b.flushFn(ctx, entries)
+}
+
+// shutdown drains any remaining buffered records through flushFn and stops the flush loop, respecting ctx as
+// a bound on how long the drain is allowed to take.
+func (b *batcher) shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.done)
+	select {
+	case <-b.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// joinBatch frames a set of already-formatted records into a single payload per the given BatchFormat.
+func joinBatch(entries [][]byte, format BatchFormat) []byte {
+	if format == BatchFormatNDJSON {
+		return bytes.Join(entries, []byte("\n"))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(e)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// gzipCompress compresses payload using gzip at the default compression level.
+func gzipCompress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(payload); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+package slogxfluentbit
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreakerState represents the current state of a circuitBreaker.
+type CircuitBreakerState string
+
+const (
+	// CircuitBreakerClosed is the normal operating state: calls are allowed through.
+	CircuitBreakerClosed CircuitBreakerState = "closed"
+
+	// CircuitBreakerOpen means recent calls have failed enough times that new calls are short-circuited
+	// until the cooldown window elapses.
+	CircuitBreakerOpen CircuitBreakerState = "open"
+
+	// CircuitBreakerHalfOpen means the cooldown window has elapsed and a single trial call is being let
+	// through to test whether the listener has recovered.
+	CircuitBreakerHalfOpen CircuitBreakerState = "half_open"
+)
+
+// CircuitBreakerStateChangeFunc is called whenever a circuit breaker transitions between states.
+type CircuitBreakerStateChangeFunc func(from, to CircuitBreakerState)
+
+// circuitBreaker trips after a run of consecutive failures and short-circuits calls for a cooldown window,
+// giving a struggling Fluent Bit listener room to recover instead of being hammered with retries.
+type circuitBreaker struct {
+	mu            sync.Mutex
+	state         CircuitBreakerState
+	failures      int
+	threshold     int
+	cooldown      time.Duration
+	openedAt      time.Time
+	onStateChange CircuitBreakerStateChangeFunc
+}
+
+// newCircuitBreaker creates a new circuitBreaker that opens after threshold consecutive failures and stays
+// open for cooldown before allowing a trial call through.
+func newCircuitBreaker(threshold int, cooldown time.Duration, onStateChange CircuitBreakerStateChangeFunc) *circuitBreaker {
+	return &circuitBreaker{
+		state:         CircuitBreakerClosed,
+		threshold:     threshold,
+		cooldown:      cooldown,
+		onStateChange: onStateChange,
+	}
+}
+
+// allow reports whether a call may proceed, transitioning from Open to HalfOpen once the cooldown has
+// elapsed. Only a single trial call is admitted while HalfOpen; every other caller is short-circuited until
+// that trial's outcome is recorded via recordSuccess or recordFailure.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitBreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(CircuitBreakerHalfOpen)
+		return true
+	case CircuitBreakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// recordSuccess resets the failure count and closes the breaker.
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.setState(CircuitBreakerClosed)
+}
+
+// recordFailure increments the failure count, tripping the breaker open once threshold consecutive failures
+// have been observed. A failed trial call while HalfOpen reopens the breaker immediately.
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitBreakerHalfOpen {
+		b.openedAt = time.Now()
+		b.setState(CircuitBreakerOpen)
+		return
+	}
+
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(CircuitBreakerOpen)
+	}
+}
+
+// setState transitions the breaker to newState, invoking onStateChange if the state actually changed. The
+// caller must hold b.mu.
+func (b *circuitBreaker) setState(newState CircuitBreakerState) {
+	if b.state == newState {
+		return
+	}
+	oldState := b.state
+	b.state = newState
+	if b.onStateChange != nil {
+		b.onStateChange(oldState, newState)
+	}
+}
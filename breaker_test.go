@@ -0,0 +1,77 @@
+package slogxfluentbit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b := newCircuitBreaker(2, time.Minute, nil)
+
+	if !b.allow() {
+		t.Fatal("expected breaker to allow the first call while closed")
+	}
+	b.recordFailure()
+	if b.state != CircuitBreakerClosed {
+		t.Fatalf("state = %s, want closed after 1 of 2 failures", b.state)
+	}
+
+	b.recordFailure()
+	if b.state != CircuitBreakerOpen {
+		t.Fatalf("state = %s, want open after 2 of 2 failures", b.state)
+	}
+	if b.allow() {
+		t.Fatal("expected breaker to short-circuit calls while open and within cooldown")
+	}
+}
+
+func TestCircuitBreakerHalfOpenAdmitsOnlyOneTrial(t *testing.T) {
+	b := newCircuitBreaker(1, 10*time.Millisecond, nil)
+	b.recordFailure() // trips open
+
+	time.Sleep(15 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected the first call after cooldown to be admitted as the trial")
+	}
+	if b.state != CircuitBreakerHalfOpen {
+		t.Fatalf("state = %s, want half_open", b.state)
+	}
+
+	for i := 0; i < 5; i++ {
+		if b.allow() {
+			t.Fatal("expected every other concurrent call to be refused while a trial is in flight")
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := newCircuitBreaker(1, 10*time.Millisecond, nil)
+	b.recordFailure()
+	time.Sleep(15 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected the trial call to be admitted")
+	}
+	b.recordFailure()
+	if b.state != CircuitBreakerOpen {
+		t.Fatalf("state = %s, want open after the trial call failed", b.state)
+	}
+}
+
+func TestCircuitBreakerHalfOpenSuccessCloses(t *testing.T) {
+	b := newCircuitBreaker(1, 10*time.Millisecond, nil)
+	b.recordFailure()
+	time.Sleep(15 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected the trial call to be admitted")
+	}
+	b.recordSuccess()
+	if b.state != CircuitBreakerClosed {
+		t.Fatalf("state = %s, want closed after the trial call succeeded", b.state)
+	}
+	if !b.allow() {
+		t.Fatal("expected the breaker to allow calls again once closed")
+	}
+}
@@ -0,0 +1,49 @@
+package slogxfluentbit
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext carries the values of a parent context without its cancellation or deadline, so a
+// goroutine can keep reading context values (e.g. request-scoped options) after the call that spawned it has
+// already returned and its original context has been canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+// detach returns a context that behaves like ctx for Value() lookups but is otherwise never canceled and
+// has no deadline.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (d detachedContext) Value(key any) any         { return d.parent.Value(key) }
+
+// asyncContext combines the values of a detached caller context with the cancellation of a handler-level
+// shutdown context, so an in-flight async Handle() call keeps the values the caller set (loggers, trace
+// IDs, ...) while still being bounded by Shutdown(ctx).
+type asyncContext struct {
+	shutdown context.Context
+	values   context.Context
+}
+
+// newAsyncContext builds a context for an async Handle() call: cancellation/deadline come from shutdownCtx,
+// values come from callerCtx (detached from callerCtx's own cancellation).
+func newAsyncContext(shutdownCtx, callerCtx context.Context) context.Context {
+	return asyncContext{shutdown: shutdownCtx, values: detach(callerCtx)}
+}
+
+func (a asyncContext) Deadline() (time.Time, bool) { return a.shutdown.Deadline() }
+func (a asyncContext) Done() <-chan struct{}       { return a.shutdown.Done() }
+func (a asyncContext) Err() error                  { return a.shutdown.Err() }
+
+func (a asyncContext) Value(key any) any {
+	if v := a.values.Value(key); v != nil {
+		return v
+	}
+	return a.shutdown.Value(key)
+}
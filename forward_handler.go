@@ -0,0 +1,595 @@
+package slogxfluentbit
+
+import (
+	"context"
+	"crypto/sha512"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.innotegrity.dev/async"
+	"go.innotegrity.dev/generic"
+	"go.innotegrity.dev/slogx"
+	"go.innotegrity.dev/slogx/formatter"
+	"golang.org/x/exp/slog"
+)
+
+// fluentForwardHandlerOptionsContext can be used to retrieve the options used by the handler from the context.
+type fluentForwardHandlerOptionsContext struct{}
+
+// FluentForwardHandlerOptions holds the options for the Fluent Bit Forward protocol handler.
+type FluentForwardHandlerOptions struct {
+	// Network is the network type used to dial Address (e.g. tcp, tcp4, tcp6, unix).
+	//
+	// By default, this is set to tcp.
+	Network string
+
+	// Address is the address of the Fluent Bit forward input listener, e.g. host:port.
+	//
+	// This is a required option.
+	Address string
+
+	// Tag is the Fluent Bit tag attached to every record sent over this connection.
+	//
+	// This is a required option.
+	Tag string
+
+	// SharedKey, when set, is used to authenticate with a Fluent Bit forward input configured with
+	// shared_key authentication.
+	SharedKey string
+
+	// Username and Password, when set together with SharedKey, are used to satisfy a forward input that
+	// also requires user-based authentication.
+	Username string
+	Password string
+
+	// RequireAck enables Fluent Bit's acknowledgement mode: each PackedForward chunk is sent with a random
+	// chunk option and the handler waits for a matching {"ack": "<chunk>"} response before considering the
+	// chunk delivered.
+	RequireAck bool
+
+	// TLSConfig, when set, upgrades the connection to TLS using the given configuration.
+	TLSConfig *tls.Config
+
+	// WriteTimeout caps how long a single write (and, when RequireAck is enabled, the wait for its ack) may
+	// take before failing.
+	//
+	// By default, this is set to 10 seconds.
+	WriteTimeout time.Duration
+
+	// EnableAsync will execute the Handle() function in a separate goroutine.
+	//
+	// When async is enabled, you should be sure to call the Shutdown() function or use the slogx.Shutdown()
+	// function to ensure all goroutines are finished and any pending records have been written.
+	EnableAsync bool
+
+	// Level is the minimum log level to write to the handler.
+	//
+	// By default, the level will be set to slog.LevelInfo if not supplied.
+	Level slog.Leveler
+
+	// RecordFormatter specifies the formatter to use to format the record before encoding it for the
+	// forward input.
+	//
+	// If no formatter is supplied, formatter.DefaultJSONFormatter is used to format the output.
+	RecordFormatter formatter.BufferFormatter
+
+	// BatchSize is the maximum number of records to coalesce into a single PackedForward chunk.
+	//
+	// By default, this is set to 100.
+	BatchSize int
+
+	// BatchFlushInterval is the maximum amount of time a partially-filled chunk is held before being sent.
+	//
+	// By default, this is set to 5 seconds.
+	BatchFlushInterval time.Duration
+
+	// MaxBufferBytes caps the total size, in bytes, of formatted records waiting to be sent.
+	//
+	// If 0, the buffer is only bounded by BatchSize.
+	MaxBufferBytes int
+
+	// OverflowPolicy controls what happens when the in-memory batch buffer is full.
+	//
+	// By default, this is set to OverflowPolicyBlockWithTimeout.
+	OverflowPolicy OverflowPolicy
+
+	// OverflowTimeout is the maximum amount of time Handle() will block waiting for room in the batch buffer
+	// when OverflowPolicy is OverflowPolicyBlockWithTimeout before giving up and returning an error.
+	//
+	// By default, this is set to 5 seconds.
+	OverflowTimeout time.Duration
+
+	// RetryPolicy, when set, retries a chunk that failed to send, or whose ack did not arrive in time or
+	// did not match, using exponential backoff.
+	//
+	// If nil, a failed chunk is returned to the caller immediately without being retried.
+	RetryPolicy *RetryPolicy
+
+	// FallbackHandler receives chunks that could not be delivered to the forward input after RetryPolicy was
+	// exhausted.
+	//
+	// If nil, such records are simply dropped. Chunks are sent by the background flush loop, so the error
+	// is not returned from Handle().
+	FallbackHandler slog.Handler
+}
+
+// DefaultFluentForwardHandlerOptions returns a default set of options for the handler.
+func DefaultFluentForwardHandlerOptions() FluentForwardHandlerOptions {
+	return FluentForwardHandlerOptions{
+		Network:            "tcp",
+		WriteTimeout:       10 * time.Second,
+		Level:              slog.LevelInfo,
+		RecordFormatter:    formatter.DefaultJSONFormatter(),
+		BatchSize:          100,
+		BatchFlushInterval: 5 * time.Second,
+		OverflowPolicy:     OverflowPolicyBlockWithTimeout,
+		OverflowTimeout:    5 * time.Second,
+	}
+}
+
+// GetFluentForwardHandlerOptionsFromContext retrieves the options from the context.
+//
+// If the options are not set in the context, a set of default options is returned instead.
+func GetFluentForwardHandlerOptionsFromContext(ctx context.Context) *FluentForwardHandlerOptions {
+	o := ctx.Value(fluentForwardHandlerOptionsContext{})
+	if o != nil {
+		if opts, ok := o.(*FluentForwardHandlerOptions); ok {
+			return opts
+		}
+	}
+	opts := DefaultFluentForwardHandlerOptions()
+	return &opts
+}
+
+// AddToContext adds the options to the given context and returns the new context.
+func (o *FluentForwardHandlerOptions) AddToContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fluentForwardHandlerOptionsContext{}, o)
+}
+
+// fluentForwardHandler is a log handler that writes records to a Fluent Bit forward input over a persistent
+// TCP/TLS connection using the Forward protocol's PackedForward mode.
+type fluentForwardHandler struct {
+	activeGroup    string
+	attrs          []slog.Attr
+	batcher        *batcher
+	conn           *forwardConn
+	futures        []async.Future
+	groups         []string
+	options        FluentForwardHandlerOptions
+	shutdownCancel context.CancelFunc
+	shutdownCtx    context.Context
+}
+
+// NewFluentForwardHandler creates a new handler object that writes records to a Fluent Bit forward input.
+func NewFluentForwardHandler(opts FluentForwardHandlerOptions) (*fluentForwardHandler, error) {
+	// validate required options
+	if opts.Address == "" {
+		return nil, errors.New("Address is required and cannot be empty")
+	}
+	if opts.Tag == "" {
+		return nil, errors.New("Tag is required and cannot be empty")
+	}
+
+	// set default options
+	if opts.Network == "" {
+		opts.Network = "tcp"
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.BatchFlushInterval <= 0 {
+		opts.BatchFlushInterval = 5 * time.Second
+	}
+	if opts.OverflowPolicy == "" {
+		opts.OverflowPolicy = OverflowPolicyBlockWithTimeout
+	}
+	if opts.OverflowTimeout <= 0 {
+		opts.OverflowTimeout = 5 * time.Second
+	}
+
+	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
+	h := &fluentForwardHandler{
+		attrs:          []slog.Attr{},
+		conn:           newForwardConn(&opts),
+		futures:        []async.Future{},
+		groups:         []string{},
+		options:        opts,
+		shutdownCancel: shutdownCancel,
+		shutdownCtx:    shutdownCtx,
+	}
+
+	// the batching subsystem expects a FluentBitHandlerOptions pointer, so translate the subset of knobs it
+	// actually consults rather than duplicating its buffering logic here
+	batchOpts := &FluentBitHandlerOptions{
+		BatchSize:          opts.BatchSize,
+		BatchFlushInterval: opts.BatchFlushInterval,
+		MaxBufferBytes:     opts.MaxBufferBytes,
+		OverflowPolicy:     opts.OverflowPolicy,
+		OverflowTimeout:    opts.OverflowTimeout,
+	}
+	h.batcher = newBatcher(batchOpts, h.sendBatch)
+	h.batcher.start()
+	return h, nil
+}
+
+// Enabled determines whether or not the given level is enabled in this handler.
+func (h fluentForwardHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.options.Level.Level()
+}
+
+// Handle formats the record and enqueues it to be coalesced into a PackedForward chunk.
+func (h *fluentForwardHandler) Handle(ctx context.Context, r slog.Record) error {
+	handlerCtx := h.options.AddToContext(ctx)
+	if !h.options.EnableAsync {
+		return h.handle(handlerCtx, r)
+	}
+
+	// the goroutine must outlive this call returning (and handlerCtx being canceled by the caller), but
+	// still needs to respect a handler-level Shutdown(ctx) deadline
+	asyncCtx := newAsyncContext(h.shutdownCtx, handlerCtx)
+	future := async.Exec(func() any {
+		return h.handle(asyncCtx, r)
+	})
+	h.futures = append(h.futures, future)
+	return nil
+}
+
+// ShutdownContext drains any remaining buffered records and closes the underlying connection, respecting
+// ctx as a bound on how long draining is allowed to take.
+func (h fluentForwardHandler) ShutdownContext(ctx context.Context, continueOnError bool) error {
+	if h.shutdownCancel != nil {
+		// in-flight async Handle() calls keep running until ctx is done and are only canceled then
+		stop := context.AfterFunc(ctx, h.shutdownCancel)
+		defer stop()
+		defer h.shutdownCancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, f := range h.futures {
+			if f != nil {
+				f.Await()
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	err := h.batcher.shutdown(ctx)
+	if closeErr := h.conn.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Shutdown is retained for callers built against the handler before ShutdownContext was introduced.
+//
+// Deprecated: use ShutdownContext instead so drain time is bounded by ctx.
+func (h fluentForwardHandler) Shutdown(continueOnError bool) error {
+	return h.ShutdownContext(context.Background(), continueOnError)
+}
+
+// WithAttrs creates a new handler from the existing one adding the given attributes to it.
+func (h fluentForwardHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	newHandler := &fluentForwardHandler{
+		attrs:          h.attrs,
+		batcher:        h.batcher,
+		conn:           h.conn,
+		futures:        h.futures,
+		groups:         h.groups,
+		options:        h.options,
+		shutdownCancel: h.shutdownCancel,
+		shutdownCtx:    h.shutdownCtx,
+	}
+	if h.activeGroup == "" {
+		newHandler.attrs = append(newHandler.attrs, attrs...)
+	} else {
+		newHandler.attrs = append(newHandler.attrs, slog.Group(h.activeGroup, generic.AnySlice(attrs)...))
+		newHandler.activeGroup = h.activeGroup
+	}
+	return newHandler
+}
+
+// WithGroup creates a new handler from the existing one adding the given group to it.
+func (h fluentForwardHandler) WithGroup(name string) slog.Handler {
+	newHandler := &fluentForwardHandler{
+		attrs:          h.attrs,
+		batcher:        h.batcher,
+		conn:           h.conn,
+		futures:        h.futures,
+		groups:         h.groups,
+		options:        h.options,
+		shutdownCancel: h.shutdownCancel,
+		shutdownCtx:    h.shutdownCtx,
+	}
+	if name != "" {
+		newHandler.groups = append(newHandler.groups, name)
+		newHandler.activeGroup = name
+	}
+	return newHandler
+}
+
+// handle formats the record and enqueues the resulting JSON into the batch buffer.
+func (h fluentForwardHandler) handle(ctx context.Context, r slog.Record) error {
+	attrs := slogx.ConsolidateAttrs(h.attrs, h.activeGroup, r)
+
+	var buf *slogx.Buffer
+	var err error
+	if h.options.RecordFormatter != nil {
+		buf, err = h.options.RecordFormatter.FormatRecord(ctx, r.Time, slogx.Level(r.Level), r.PC, r.Message,
+			attrs)
+	} else {
+		f := formatter.DefaultJSONFormatter()
+		buf, err = f.FormatRecord(ctx, r.Time, slogx.Level(r.Level), r.PC, r.Message, attrs)
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.batcher.enqueue(ctx, []byte(buf.String()))
+}
+
+// sendBatch decodes the batched JSON records, encodes them as a PackedForward chunk, and sends the chunk to
+// the forward input, retrying per RetryPolicy on a send failure or a missing/mismatched ack.
+func (h fluentForwardHandler) sendBatch(ctx context.Context, entries [][]byte) error {
+	now := time.Now()
+	timestamps := make([]time.Time, len(entries))
+	records := make([]map[string]any, len(entries))
+	for i, e := range entries {
+		record, err := recordFromJSON(e)
+		if err != nil {
+			return err
+		}
+		timestamps[i] = now
+		records[i] = record
+	}
+
+	policy := h.options.RetryPolicy
+	maxRetries := 0
+	if policy != nil {
+		maxRetries = policy.MaxRetries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		err := h.sendChunk(ctx, timestamps, records)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		if policy == nil || attempt >= maxRetries {
+			break
+		}
+		timer := time.NewTimer(policy.nextInterval(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return h.fallback(ctx, entries, ctx.Err())
+		case <-timer.C:
+		}
+	}
+	return h.fallback(ctx, entries, lastErr)
+}
+
+// sendChunk encodes and writes a single PackedForward chunk, waiting for its ack if RequireAck is set.
+func (h fluentForwardHandler) sendChunk(ctx context.Context, timestamps []time.Time, records []map[string]any) error {
+	chunk := ""
+	if h.options.RequireAck {
+		id, err := newChunkID()
+		if err != nil {
+			return err
+		}
+		chunk = id
+	}
+
+	payload, err := encodePackedForward(h.options.Tag, timestamps, records, chunk)
+	if err != nil {
+		return err
+	}
+
+	return h.conn.send(payload, chunk)
+}
+
+// fallback hands the raw formatted entries to FallbackHandler, if configured, after sendErr has made
+// delivery to the forward input impossible.
+func (h fluentForwardHandler) fallback(ctx context.Context, entries [][]byte, sendErr error) error {
+	if h.options.FallbackHandler == nil {
+		return sendErr
+	}
+
+	r := slog.NewRecord(time.Now(), slog.LevelWarn, "failed to deliver record(s) to Fluent Bit forward input, "+
+		"falling back", 0)
+	r.AddAttrs(slog.String("error", sendErr.Error()), slog.Int("record_count", len(entries)))
+	if err := h.options.FallbackHandler.Handle(ctx, r); err != nil {
+		return fmt.Errorf("%w (fallback handler also failed: %s)", sendErr, err)
+	}
+	return nil
+}
+
+// forwardConn owns the persistent connection to the forward input, reconnecting and re-authenticating as
+// needed.
+type forwardConn struct {
+	options *FluentForwardHandlerOptions
+	conn    net.Conn
+}
+
+// newForwardConn creates a forwardConn that lazily dials on the first send.
+func newForwardConn(opts *FluentForwardHandlerOptions) *forwardConn {
+	return &forwardConn{options: opts}
+}
+
+// send writes payload to the connection, dialing (and authenticating) if necessary, and waits for a matching
+// ack when chunk is non-empty.
+func (c *forwardConn) send(payload []byte, chunk string) error {
+	conn, err := c.ensureConn()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(c.options.WriteTimeout)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := conn.Write(payload); err != nil {
+		c.reset()
+		return err
+	}
+
+	if chunk == "" {
+		return nil
+	}
+
+	dec := msgpack.NewDecoder(conn)
+	var resp struct {
+		Ack string `msgpack:"ack"`
+	}
+	if err := dec.Decode(&resp); err != nil {
+		c.reset()
+		return err
+	}
+	if resp.Ack != chunk {
+		c.reset()
+		return fmt.Errorf("ack mismatch: expected chunk %q, got %q", chunk, resp.Ack)
+	}
+	return nil
+}
+
+// ensureConn returns the current connection, dialing and, if configured, authenticating a new one if none is
+// currently open.
+func (c *forwardConn) ensureConn() (net.Conn, error) {
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	dialer := &net.Dialer{Timeout: c.options.WriteTimeout}
+	var conn net.Conn
+	var err error
+	if c.options.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, c.options.Network, c.options.Address, c.options.TLSConfig)
+	} else {
+		conn, err = dialer.Dial(c.options.Network, c.options.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.options.SharedKey != "" || c.options.Username != "" {
+		if err := performHandshake(conn, c.options); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	c.conn = conn
+	return conn, nil
+}
+
+// reset closes the current connection, if any, so the next send dials a fresh one.
+func (c *forwardConn) reset() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// close shuts down the underlying connection.
+func (c *forwardConn) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// performHandshake carries out Fluentd's HELO/PING/PONG authentication handshake against a newly dialed
+// connection, as required by forward inputs configured with shared_key and/or user authentication.
+func performHandshake(conn net.Conn, opts *FluentForwardHandlerOptions) error {
+	dec := msgpack.NewDecoder(conn)
+
+	var helo []any
+	if err := dec.Decode(&helo); err != nil {
+		return fmt.Errorf("failed to read HELO: %w", err)
+	}
+	if len(helo) < 2 {
+		return errors.New("malformed HELO message from forward input")
+	}
+	heloOpts, _ := helo[1].(map[string]any)
+	nonce, _ := heloOpts["nonce"].(string)
+	authSalt, _ := heloOpts["auth"].(string)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	var passwordDigest string
+	if opts.Username != "" {
+		passwordDigest = passwordDigestHex(authSalt, opts.Username, opts.Password)
+	}
+
+	ping := []any{
+		"PING",
+		hostname,
+		c2sSalt,
+		sharedKeyDigestHex(c2sSalt, nonce, opts.SharedKey),
+		opts.Username,
+		passwordDigest,
+	}
+	pingBytes, err := msgpack.Marshal(ping)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(pingBytes); err != nil {
+		return fmt.Errorf("failed to write PING: %w", err)
+	}
+
+	var pong []any
+	if err := dec.Decode(&pong); err != nil {
+		return fmt.Errorf("failed to read PONG: %w", err)
+	}
+	if len(pong) < 3 {
+		return errors.New("malformed PONG message from forward input")
+	}
+	authOK, _ := pong[1].(bool)
+	reason, _ := pong[2].(string)
+	if !authOK {
+		return fmt.Errorf("forward input rejected authentication: %s", reason)
+	}
+	return nil
+}
+
+// sharedKeyDigestHex computes the hex-encoded shared-key digest Fluentd's forward protocol expects in PING:
+// sha512_hex(salt + nonce + sharedKey).
+func sharedKeyDigestHex(salt, nonce, sharedKey string) string {
+	digest := sha512.Sum512(append(append([]byte(salt), []byte(nonce)...), []byte(sharedKey)...))
+	return fmt.Sprintf("%x", digest)
+}
+
+// passwordDigestHex computes the hex-encoded user/password digest Fluentd's forward protocol expects in
+// PING when user authentication is configured: sha512_hex(authSalt + username + password).
+func passwordDigestHex(authSalt, username, password string) string {
+	digest := sha512.Sum512(append(append([]byte(authSalt), []byte(username)...), []byte(password)...))
+	return fmt.Sprintf("%x", digest)
+}
+
+// c2sSalt is the client-to-server salt sent as part of the PING message; it is not a secret and, per the
+// Fluentd spec, may be an arbitrary non-empty string.
+const c2sSalt = "slogx-fluentbit"
@@ -0,0 +1,21 @@
+package slogxfluentbit
+
+import "testing"
+
+func TestSharedKeyDigestHex(t *testing.T) {
+	got := sharedKeyDigestHex("salt123", "nonce456", "mysecret")
+	want := "aee70655232444587fc237c6d94f668fa6c4ba7115d628cb9a5521563c00bf5" +
+		"f3f05ab38f01cbd9b777e585fd74a645183a4c198d1b8fd776adc58e56096ef40"
+	if got != want {
+		t.Errorf("sharedKeyDigestHex() = %s, want %s", got, want)
+	}
+}
+
+func TestPasswordDigestHex(t *testing.T) {
+	got := passwordDigestHex("authsalt789", "alice", "hunter2")
+	want := "480d8394d180703cd96fc33d34a39861e8a91e296001c6408f9d0c4c3879797" +
+		"0a2d5ccf64055df7ac6a18aff68aff03fd0693401d31319a9cae570907f61346e"
+	if got != want {
+		t.Errorf("passwordDigestHex() = %s, want %s", got, want)
+	}
+}
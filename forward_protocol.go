@@ -0,0 +1,82 @@
+package slogxfluentbit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// fluentdEventTimeExtType is the MessagePack ext type id Fluentd/Fluent Bit use for the EventTime extension:
+// an 8-byte payload of a big-endian uint32 seconds field followed by a big-endian uint32 nanoseconds field.
+const fluentdEventTimeExtType = 0
+
+// eventTime encodes a time.Time using Fluentd's EventTime MessagePack extension (ext type 0, 8 bytes).
+type eventTime struct {
+	t time.Time
+}
+
+// EncodeMsgpack implements msgpack.CustomEncoder.
+func (e eventTime) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeExtHeader(fluentdEventTimeExtType, 8); err != nil {
+		return err
+	}
+	var payload [8]byte
+	binary.BigEndian.PutUint32(payload[0:4], uint32(e.t.Unix()))
+	binary.BigEndian.PutUint32(payload[4:8], uint32(e.t.Nanosecond()))
+	_, err := enc.Writer().Write(payload[:])
+	return err
+}
+
+// recordFromJSON unmarshals a formatted JSON record into the map MessagePack needs to encode it as a Forward
+// protocol record.
+func recordFromJSON(formatted []byte) (map[string]any, error) {
+	record := map[string]any{}
+	if err := json.Unmarshal(formatted, &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// newChunkID returns a random, base64-encoded 16-byte chunk identifier used to correlate a PackedForward
+// message with its acknowledgement.
+func newChunkID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// forwardOption is the trailing "option" map of a Forward protocol message.
+type forwardOption struct {
+	Chunk string `msgpack:"chunk,omitempty"`
+}
+
+// encodeForwardEntry encodes a single [timestamp, record] pair as used within PackedForward entries.
+func encodeForwardEntry(t time.Time, record map[string]any) ([]byte, error) {
+	return msgpack.Marshal([]any{eventTime{t}, record})
+}
+
+// encodePackedForward builds a complete PackedForward message: [tag, entries, option], where entries is the
+// concatenation of the individually MessagePack-encoded [timestamp, record] pairs in records.
+func encodePackedForward(tag string, timestamps []time.Time, records []map[string]any, chunk string) ([]byte, error) {
+	var entries bytes.Buffer
+	for i, record := range records {
+		entry, err := encodeForwardEntry(timestamps[i], record)
+		if err != nil {
+			return nil, err
+		}
+		entries.Write(entry)
+	}
+
+	opt := forwardOption{}
+	if chunk != "" {
+		opt.Chunk = chunk
+	}
+	return msgpack.Marshal([]any{tag, entries.Bytes(), opt})
+}
@@ -2,8 +2,11 @@ package slogxfluentbit
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"go.innotegrity.dev/async"
@@ -48,15 +51,143 @@ type FluentBitHandlerOptions struct {
 	//
 	// This is a required option.
 	URL string
+
+	// BatchSize is the maximum number of records to accumulate before flushing a batch to the HTTP listener.
+	//
+	// If 0, batching is disabled and each record is posted individually as soon as Handle() is called.
+	BatchSize int
+
+	// BatchFlushInterval is the maximum amount of time a partially-filled batch is held before being flushed.
+	//
+	// This is only used when BatchSize is greater than 0. By default, this is set to 5 seconds.
+	BatchFlushInterval time.Duration
+
+	// BatchFormat controls how multiple records are framed within a single batch payload.
+	//
+	// By default, this is set to BatchFormatJSONArray.
+	BatchFormat BatchFormat
+
+	// MaxBufferBytes caps the total size, in bytes, of formatted records waiting to be flushed.
+	//
+	// If 0, the buffer is only bounded by BatchSize.
+	MaxBufferBytes int
+
+	// OverflowPolicy controls what happens when the in-memory batch buffer is full.
+	//
+	// By default, this is set to OverflowPolicyBlockWithTimeout.
+	OverflowPolicy OverflowPolicy
+
+	// OverflowTimeout is the maximum amount of time Handle() will block waiting for room in the batch buffer
+	// when OverflowPolicy is OverflowPolicyBlockWithTimeout before giving up and returning an error.
+	//
+	// By default, this is set to 5 seconds.
+	OverflowTimeout time.Duration
+
+	// Compression specifies the compression algorithm to apply to batch payloads before POSTing them.
+	//
+	// By default, this is set to CompressionNone. It applies to every POST, whether batched, unbatched, or
+	// shipped from the spool.
+	Compression Compression
+
+	// RetryPolicy, when set, retries failed HTTP attempts using exponential backoff.
+	//
+	// If nil, a failed attempt is returned to the caller immediately without being retried.
+	RetryPolicy *RetryPolicy
+
+	// CircuitBreakerThreshold is the number of consecutive failed attempts, after RetryPolicy is exhausted,
+	// before the circuit breaker opens and short-circuits further calls for CircuitBreakerCooldown.
+	//
+	// If 0, the circuit breaker is disabled.
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerCooldown is how long the circuit breaker stays open before allowing a trial call
+	// through to test whether the Fluent Bit listener has recovered.
+	//
+	// By default, this is set to 30 seconds.
+	CircuitBreakerCooldown time.Duration
+
+	// CircuitBreakerStateChangeFunc, if set, is called whenever the circuit breaker transitions between
+	// states. This is useful for surfacing breaker trips through metrics or alerting.
+	CircuitBreakerStateChangeFunc CircuitBreakerStateChangeFunc
+
+	// FallbackHandler receives records that could not be delivered to the Fluent Bit listener, whether
+	// because the circuit breaker is open or because RetryPolicy was exhausted.
+	//
+	// If nil, such records are simply dropped and the originating error is returned from Handle(). When
+	// batching is enabled, batches are posted by the background flush loop and the error is not returned
+	// from Handle().
+	FallbackHandler slog.Handler
+
+	// BasicAuth, when set, is applied to the HTTP client as HTTP basic authentication credentials.
+	BasicAuth *BasicAuth
+
+	// BearerToken, when set, is sent as a static "Authorization: Bearer <token>" header.
+	//
+	// For a token that needs to be refreshed over the handler's lifetime, use TokenProvider instead.
+	BearerToken string
+
+	// TokenProvider, when set, supplies a rotating bearer token (e.g. for OAuth2/OIDC-style authentication).
+	// The token is cached until the expiry TokenProvider returns and transparently refreshed, including
+	// after a 401 response.
+	TokenProvider TokenProviderFunc
+
+	// TLSConfig, when set, is applied to the HTTP client's transport.
+	TLSConfig *tls.Config
+
+	// ClientCertFile and ClientKeyFile, when set, load a client certificate used for mTLS. They are merged
+	// into TLSConfig rather than replacing it.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// CAFile, when set, loads a PEM-encoded CA bundle used to verify the Fluent Bit listener's certificate.
+	// It is merged into TLSConfig rather than replacing it.
+	CAFile string
+
+	// AuthOverride, when true, disables automatic wiring of BasicAuth, BearerToken, and TLS settings into
+	// HTTPClient. Set this if HTTPClient already has its own auth configured and should not be touched.
+	AuthOverride bool
+
+	// RequestTimeout, when set, bounds how long a single POST attempt (including a retried attempt) is
+	// allowed to take before it is treated as a failure.
+	//
+	// If 0, an attempt is only bounded by ctx and the HTTP client's own timeout, if any.
+	RequestTimeout time.Duration
+
+	// SpoolDir, when set, enables a persistent write-ahead spool: formatted records are appended to on-disk
+	// segment files and delivered by a background goroutine, so pending records survive both process
+	// restarts and extended Fluent Bit outages. This takes the place of the in-memory batch buffer; BatchSize
+	// and related options are ignored while SpoolDir is set.
+	//
+	// If empty, the spool is disabled.
+	SpoolDir string
+
+	// MaxSpoolBytes caps the total on-disk size of records that have been spooled but not yet delivered.
+	// OverflowPolicy governs what happens once the cap is reached.
+	//
+	// If 0, the spool is unbounded.
+	MaxSpoolBytes int64
+
+	// SpoolSegmentBytes is the size at which the spool rotates to a new segment file. Segments are deleted
+	// once every record in them has been delivered.
+	//
+	// By default, this is set to 16 MiB.
+	SpoolSegmentBytes int64
 }
 
 // DefaultFluentBitHandlerOptions returns a default set of options for the handler.
 func DefaultFluentBitHandlerOptions() FluentBitHandlerOptions {
 	return FluentBitHandlerOptions{
-		ContentType:     "application/json",
-		HTTPClient:      resty.New(),
-		Level:           slog.LevelInfo,
-		RecordFormatter: formatter.DefaultJSONFormatter(),
+		ContentType:            "application/json",
+		HTTPClient:             resty.New(),
+		Level:                  slog.LevelInfo,
+		RecordFormatter:        formatter.DefaultJSONFormatter(),
+		BatchFlushInterval:     5 * time.Second,
+		BatchFormat:            BatchFormatJSONArray,
+		OverflowPolicy:         OverflowPolicyBlockWithTimeout,
+		OverflowTimeout:        5 * time.Second,
+		Compression:            CompressionNone,
+		CircuitBreakerCooldown: 30 * time.Second,
+		SpoolSegmentBytes:      defaultSpoolSegmentBytes,
 	}
 }
 
@@ -81,11 +212,17 @@ func (o *FluentBitHandlerOptions) AddToContext(ctx context.Context) context.Cont
 
 // fluentBitHandler is a log handler that writes records to a Fluent Bit HTTP listener.
 type fluentBitHandler struct {
-	activeGroup string
-	attrs       []slog.Attr
-	futures     []async.Future
-	groups      []string
-	options     FluentBitHandlerOptions
+	activeGroup    string
+	attrs          []slog.Attr
+	batcher        *batcher
+	breaker        *circuitBreaker
+	futures        []async.Future
+	groups         []string
+	options        FluentBitHandlerOptions
+	shutdownCancel context.CancelFunc
+	shutdownCtx    context.Context
+	spool          *spool
+	tokenCache     *authTokenCache
 }
 
 // NewFluentBitHandler creates a new handler object.
@@ -105,14 +242,65 @@ func NewFluentBitHandler(opts FluentBitHandlerOptions) (*fluentBitHandler, error
 	if opts.Level == nil {
 		opts.Level = slog.LevelInfo
 	}
+	if opts.BatchFlushInterval <= 0 {
+		opts.BatchFlushInterval = 5 * time.Second
+	}
+	if opts.BatchFormat == "" {
+		opts.BatchFormat = BatchFormatJSONArray
+	}
+	if opts.OverflowPolicy == "" {
+		opts.OverflowPolicy = OverflowPolicyBlockWithTimeout
+	}
+	if opts.OverflowTimeout <= 0 {
+		opts.OverflowTimeout = 5 * time.Second
+	}
+	if opts.Compression == "" {
+		opts.Compression = CompressionNone
+	}
+	if opts.CircuitBreakerCooldown <= 0 {
+		opts.CircuitBreakerCooldown = 30 * time.Second
+	}
+	if opts.SpoolSegmentBytes <= 0 {
+		opts.SpoolSegmentBytes = defaultSpoolSegmentBytes
+	}
+
+	// wire BasicAuth, BearerToken, and TLS settings into the HTTP client unless the caller wants full
+	// control over its auth configuration
+	if !opts.AuthOverride {
+		if err := applyAuth(opts.HTTPClient, &opts); err != nil {
+			return nil, err
+		}
+	}
 
 	// create the handler
-	return &fluentBitHandler{
-		attrs:   []slog.Attr{},
-		futures: []async.Future{},
-		groups:  []string{},
-		options: opts,
-	}, nil
+	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
+	h := &fluentBitHandler{
+		attrs:          []slog.Attr{},
+		futures:        []async.Future{},
+		groups:         []string{},
+		options:        opts,
+		shutdownCancel: shutdownCancel,
+		shutdownCtx:    shutdownCtx,
+	}
+	if opts.BatchSize > 0 {
+		h.batcher = newBatcher(&h.options, h.postBatch)
+		h.batcher.start()
+	}
+	if opts.CircuitBreakerThreshold > 0 {
+		h.breaker = newCircuitBreaker(opts.CircuitBreakerThreshold, opts.CircuitBreakerCooldown,
+			opts.CircuitBreakerStateChangeFunc)
+	}
+	if opts.TokenProvider != nil {
+		h.tokenCache = newAuthTokenCache(opts.TokenProvider)
+	}
+	if opts.SpoolDir != "" {
+		sp, err := newSpool(&h.options, h.postSpooled, h.spoolCorrupted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spool: %w", err)
+		}
+		h.spool = sp
+	}
+	return h, nil
 }
 
 // Enabled determines whether or not the given level is enabled in this handler.
@@ -130,30 +318,73 @@ func (h *fluentBitHandler) Handle(ctx context.Context, r slog.Record) error {
 		return h.handle(handlerCtx, r)
 	}
 
+	// the goroutine must outlive this call returning (and handlerCtx being canceled by the caller), but
+	// still needs to respect a handler-level Shutdown(ctx) deadline
+	asyncCtx := newAsyncContext(h.shutdownCtx, handlerCtx)
 	future := async.Exec(func() any {
-		return h.handle(handlerCtx, r)
+		return h.handle(asyncCtx, r)
 	})
 	h.futures = append(h.futures, future)
 	return nil
 }
 
-// Shutdown is responsible for cleaning up resources used by the handler.
-func (h fluentBitHandler) Shutdown(continueOnError bool) error {
-	for _, f := range h.futures {
-		if f != nil {
-			f.Await()
+// ShutdownContext is responsible for cleaning up resources used by the handler, respecting ctx as a bound on
+// how long draining pending records is allowed to take.
+func (h fluentBitHandler) ShutdownContext(ctx context.Context, continueOnError bool) error {
+	if h.shutdownCancel != nil {
+		// in-flight async Handle() calls keep running until ctx is done and are only canceled then
+		stop := context.AfterFunc(ctx, h.shutdownCancel)
+		defer stop()
+		defer h.shutdownCancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, f := range h.futures {
+			if f != nil {
+				f.Await()
+			}
 		}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if h.spool != nil {
+		if err := h.spool.shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	if h.batcher != nil {
+		return h.batcher.shutdown(ctx)
 	}
 	return nil
 }
 
+// Shutdown is retained for callers built against the handler before ShutdownContext was introduced.
+//
+// Deprecated: use ShutdownContext instead so drain time is bounded by ctx.
+func (h fluentBitHandler) Shutdown(continueOnError bool) error {
+	return h.ShutdownContext(context.Background(), continueOnError)
+}
+
 // WithAttrs creates a new handler from the existing one adding the given attributes to it.
 func (h fluentBitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	newHandler := &fluentBitHandler{
-		attrs:   h.attrs,
-		futures: h.futures,
-		groups:  h.groups,
-		options: h.options,
+		attrs:          h.attrs,
+		batcher:        h.batcher,
+		breaker:        h.breaker,
+		futures:        h.futures,
+		groups:         h.groups,
+		options:        h.options,
+		shutdownCancel: h.shutdownCancel,
+		shutdownCtx:    h.shutdownCtx,
+		spool:          h.spool,
+		tokenCache:     h.tokenCache,
 	}
 	if h.activeGroup == "" {
 		newHandler.attrs = append(newHandler.attrs, attrs...)
@@ -167,10 +398,16 @@ func (h fluentBitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 // WithGroup creates a new handler from the existing one adding the given group to it.
 func (h fluentBitHandler) WithGroup(name string) slog.Handler {
 	newHandler := &fluentBitHandler{
-		attrs:   h.attrs,
-		futures: h.futures,
-		groups:  h.groups,
-		options: h.options,
+		attrs:          h.attrs,
+		batcher:        h.batcher,
+		breaker:        h.breaker,
+		futures:        h.futures,
+		groups:         h.groups,
+		options:        h.options,
+		shutdownCancel: h.shutdownCancel,
+		shutdownCtx:    h.shutdownCtx,
+		spool:          h.spool,
+		tokenCache:     h.tokenCache,
 	}
 	if name != "" {
 		newHandler.groups = append(newHandler.groups, name)
@@ -179,7 +416,8 @@ func (h fluentBitHandler) WithGroup(name string) slog.Handler {
 	return newHandler
 }
 
-// handle is responsible for actually posting the message to the HTTP listener.
+// handle is responsible for formatting the record and either posting it directly to the HTTP listener or, when
+// batching is enabled, enqueueing it to be flushed later.
 func (h fluentBitHandler) handle(ctx context.Context, r slog.Record) error {
 	attrs := slogx.ConsolidateAttrs(h.attrs, h.activeGroup, r)
 
@@ -197,16 +435,177 @@ func (h fluentBitHandler) handle(ctx context.Context, r slog.Record) error {
 		return err
 	}
 
-	// post the message to the HTTP listener
-	resp, err := h.options.HTTPClient.R().
-		SetHeader("Content-Type", h.options.ContentType).
-		SetBody(buf.String()).
-		Post(h.options.URL)
+	if h.spool != nil {
+		return h.spool.append(ctx, []byte(buf.String()))
+	}
+	if h.batcher != nil {
+		return h.batcher.enqueue(ctx, []byte(buf.String()))
+	}
+	return h.postPayload(ctx, []byte(buf.String()))
+}
+
+// postBatch joins the formatted records in entries per the configured BatchFormat, optionally compresses the
+// result, and posts it to the HTTP listener as a single request.
+func (h fluentBitHandler) postBatch(ctx context.Context, entries [][]byte) error {
+	payload := joinBatch(entries, h.options.BatchFormat)
+	return h.postPayload(ctx, payload)
+}
+
+// postPayload posts a single, already-framed payload to the HTTP listener, applying compression, retries,
+// and circuit breaking as configured. Should delivery ultimately fail, the payload is handed to
+// FallbackHandler, if one is configured, instead of being silently dropped.
+func (h fluentBitHandler) postPayload(ctx context.Context, payload []byte) error {
+	original := payload
+
+	compressed := h.options.Compression == CompressionGzip
+	if compressed {
+		gz, err := gzipCompress(payload)
+		if err != nil {
+			return err
+		}
+		payload = gz
+	}
+
+	if h.breaker != nil && !h.breaker.allow() {
+		err := fmt.Errorf("circuit breaker open: Fluent Bit listener at %s appears unavailable", h.options.URL)
+		return h.emitFallback(ctx, original, err)
+	}
+
+	err := h.postWithRetry(ctx, payload, compressed)
+	if h.breaker != nil {
+		if err != nil {
+			h.breaker.recordFailure()
+		} else {
+			h.breaker.recordSuccess()
+		}
+	}
 	if err != nil {
-		return err
+		return h.emitFallback(ctx, original, err)
+	}
+	return nil
+}
+
+// postSpooled delivers a single spooled record directly to the HTTP listener, applying compression and
+// RetryPolicy but deliberately bypassing the circuit breaker and FallbackHandler: a spooled record already
+// has its own durability story (it stays on disk and is retried on the next shipper tick), so only a genuine
+// delivery may be treated as success. Routing it through postPayload's breaker/fallback escape hatch would
+// let an outage "deliver" every spooled record into the fallback sink and purge them from the spool, which
+// is exactly what the spool exists to prevent.
+func (h fluentBitHandler) postSpooled(ctx context.Context, payload []byte) error {
+	compressed := h.options.Compression == CompressionGzip
+	if compressed {
+		gz, err := gzipCompress(payload)
+		if err != nil {
+			return err
+		}
+		payload = gz
+	}
+	return h.postWithRetry(ctx, payload, compressed)
+}
+
+// postWithRetry posts payload to the HTTP listener, retrying transient failures per RetryPolicy. When no
+// RetryPolicy is configured, this is a single attempt, matching the handler's original behavior.
+func (h fluentBitHandler) postWithRetry(ctx context.Context, payload []byte, compressed bool) error {
+	policy := h.options.RetryPolicy
+	maxRetries := 0
+	if policy != nil {
+		maxRetries = policy.MaxRetries
 	}
-	if resp.StatusCode() >= 400 {
-		return fmt.Errorf("failed to write message - HTTP status code %d", resp.StatusCode())
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		attemptCtx := ctx
+		if h.options.RequestTimeout > 0 {
+			var cancel context.CancelFunc
+			attemptCtx, cancel = context.WithTimeout(ctx, h.options.RequestTimeout)
+			defer cancel()
+		}
+
+		resp, err := h.doPost(attemptCtx, payload, compressed)
+		if err == nil && resp.StatusCode() < 400 {
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = fmt.Errorf("failed to write message - HTTP status code %d", resp.StatusCode())
+		}
+
+		if policy == nil || attempt >= maxRetries {
+			break
+		}
+		if err == nil && !policy.isRetryableStatusCode(resp.StatusCode()) {
+			break
+		}
+
+		wait := policy.nextInterval(attempt)
+		if retryAfter, ok := parseRetryAfter(resp); ok {
+			wait = retryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return lastErr
+}
+
+// doPost performs a single HTTP attempt to post payload to the Fluent Bit listener. When TokenProvider is
+// configured, a 401 response triggers one token refresh and retry, since an expired cached token is not
+// itself a reason to give up or invoke RetryPolicy.
+func (h fluentBitHandler) doPost(ctx context.Context, payload []byte, compressed bool) (*resty.Response, error) {
+	resp, err := h.doPostOnce(ctx, payload, compressed)
+	if err != nil || h.tokenCache == nil || resp.StatusCode() != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	h.tokenCache.invalidate()
+	return h.doPostOnce(ctx, payload, compressed)
+}
+
+// doPostOnce builds and sends a single request, attaching a bearer token from TokenProvider if configured.
+func (h fluentBitHandler) doPostOnce(ctx context.Context, payload []byte, compressed bool) (*resty.Response, error) {
+	req := h.options.HTTPClient.R().SetContext(ctx).SetHeader("Content-Type", h.options.ContentType)
+	if compressed {
+		req.SetHeader("Content-Encoding", "gzip")
+	}
+	if h.tokenCache != nil {
+		token, err := h.tokenCache.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.SetAuthToken(token)
+	}
+	return req.SetBody(payload).Post(h.options.URL)
+}
+
+// emitFallback hands payload to FallbackHandler, if configured, after deliveryErr has made the primary
+// Fluent Bit listener unreachable or unwilling to accept the record.
+func (h fluentBitHandler) emitFallback(ctx context.Context, payload []byte, deliveryErr error) error {
+	if h.options.FallbackHandler == nil {
+		return deliveryErr
+	}
+
+	r := slog.NewRecord(time.Now(), slog.LevelWarn, "failed to deliver record(s) to Fluent Bit, falling back", 0)
+	r.AddAttrs(slog.String("error", deliveryErr.Error()), slog.String("payload", string(payload)))
+	if err := h.options.FallbackHandler.Handle(ctx, r); err != nil {
+		return fmt.Errorf("%w (fallback handler also failed: %s)", deliveryErr, err)
 	}
 	return nil
 }
+
+// spoolCorrupted reports a spool frame that failed its CRC check and was skipped, via FallbackHandler if
+// configured, so the record's loss is visible to operators instead of silently stalling or disappearing.
+func (h fluentBitHandler) spoolCorrupted(segment int, offset int64, corruptErr error) {
+	if h.options.FallbackHandler == nil {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), slog.LevelWarn, "skipped corrupt spool frame", 0)
+	r.AddAttrs(slog.Int("segment", segment), slog.Int64("offset", offset), slog.String("error", corruptErr.Error()))
+	_ = h.options.FallbackHandler.Handle(context.Background(), r)
+}
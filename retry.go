@@ -0,0 +1,102 @@
+package slogxfluentbit
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// RetryPolicy controls how transient failures posting to the Fluent Bit HTTP listener are retried.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retry attempts after the initial request.
+	MaxRetries int
+
+	// InitialInterval is the backoff interval used before the first retry.
+	InitialInterval time.Duration
+
+	// MaxInterval caps how large the backoff interval is allowed to grow.
+	MaxInterval time.Duration
+
+	// Multiplier is applied to the backoff interval after each attempt.
+	Multiplier float64
+
+	// RandomizationFactor adds +/- jitter to each computed interval, as a fraction of that interval.
+	RandomizationFactor float64
+
+	// RetryableStatusCodes is the set of HTTP status codes that should be retried.
+	//
+	// By default (including when nil), this is 408, 429, 500, 502, 503, and 504.
+	RetryableStatusCodes map[int]struct{}
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with sane exponential backoff defaults.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:          5,
+		InitialInterval:     500 * time.Millisecond,
+		MaxInterval:         30 * time.Second,
+		Multiplier:          2.0,
+		RandomizationFactor: 0.5,
+		RetryableStatusCodes: map[int]struct{}{
+			http.StatusRequestTimeout:      {},
+			http.StatusTooManyRequests:     {},
+			http.StatusInternalServerError: {},
+			http.StatusBadGateway:          {},
+			http.StatusServiceUnavailable:  {},
+			http.StatusGatewayTimeout:      {},
+		},
+	}
+}
+
+// isRetryableStatusCode reports whether statusCode should trigger a retry under this policy.
+func (p *RetryPolicy) isRetryableStatusCode(statusCode int) bool {
+	codes := p.RetryableStatusCodes
+	if codes == nil {
+		codes = DefaultRetryPolicy().RetryableStatusCodes
+	}
+	_, ok := codes[statusCode]
+	return ok
+}
+
+// nextInterval returns the backoff interval to wait before the given retry attempt (0-indexed), applying
+// exponential growth, a ceiling of MaxInterval, and +/- RandomizationFactor jitter.
+func (p *RetryPolicy) nextInterval(attempt int) time.Duration {
+	interval := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt))
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+	if p.RandomizationFactor > 0 {
+		delta := interval * p.RandomizationFactor
+		interval += (rand.Float64()*2 - 1) * delta
+	}
+	if interval < 0 {
+		interval = 0
+	}
+	return time.Duration(interval)
+}
+
+// parseRetryAfter extracts the Retry-After header from resp, supporting both the delay-seconds and HTTP-date
+// forms, and reports whether it was present and valid.
+func parseRetryAfter(resp *resty.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header().Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,36 @@
+package slogxfluentbit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyIsRetryableStatusCode(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	if !policy.isRetryableStatusCode(http.StatusServiceUnavailable) {
+		t.Error("expected 503 to be retryable under the default policy")
+	}
+	if policy.isRetryableStatusCode(http.StatusNotFound) {
+		t.Error("expected 404 not to be retryable under the default policy")
+	}
+}
+
+func TestRetryPolicyNextIntervalGrowsAndCaps(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     300 * time.Millisecond,
+		Multiplier:      2.0,
+	}
+
+	if got := policy.nextInterval(0); got != 100*time.Millisecond {
+		t.Errorf("nextInterval(0) = %s, want 100ms", got)
+	}
+	if got := policy.nextInterval(1); got != 200*time.Millisecond {
+		t.Errorf("nextInterval(1) = %s, want 200ms", got)
+	}
+	if got := policy.nextInterval(5); got != 300*time.Millisecond {
+		t.Errorf("nextInterval(5) = %s, want the 300ms cap", got)
+	}
+}
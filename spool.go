@@ -0,0 +1,451 @@
+package slogxfluentbit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spoolCursorFile is the name of the file tracking how far the shipper has progressed through the spool.
+const spoolCursorFile = "cursor"
+
+// spoolSegmentPattern names spool segment files as a zero-padded, monotonically increasing sequence number.
+const spoolSegmentPattern = "%06d.log"
+
+// defaultSpoolSegmentBytes is the size at which the spool rotates to a new segment file if the caller
+// didn't specify one.
+const defaultSpoolSegmentBytes = 16 * 1024 * 1024
+
+// spoolShipInterval is how often the shipper checks the spool for unshipped frames.
+const spoolShipInterval = 250 * time.Millisecond
+
+// spoolShipFunc delivers a single spooled record to the Fluent Bit listener. It is only considered to have
+// succeeded, and the spool cursor only advances, on a nil return. It must reflect genuine delivery only: a
+// ship function that swallows failures into a fallback sink (as postPayload does) would make the spool
+// silently discard records it is supposed to retain for eventual redelivery.
+type spoolShipFunc func(ctx context.Context, payload []byte) error
+
+// spoolCorruptFunc is called when the spool encounters a frame that fails its CRC check, which the shipper
+// skips over rather than getting permanently stuck on.
+type spoolCorruptFunc func(segment int, offset int64, err error)
+
+// errSpoolFrameCorrupt indicates a frame was read in full but failed its CRC32 check.
+var errSpoolFrameCorrupt = errors.New("spool: frame CRC mismatch, segment may be corrupt")
+
+// spoolCursor records the shipper's read position: the segment currently being read and the byte offset
+// within it of the next unshipped frame.
+type spoolCursor struct {
+	segment int
+	offset  int64
+}
+
+// spool is a write-ahead, on-disk queue that makes record delivery durable across process restarts and
+// extended Fluent Bit outages. Records are appended to length-prefixed, CRC32-checked segment files; a
+// background shipper goroutine reads them in order and advances a cursor file only once a record has
+// actually been delivered by shipFn. Segment files are deleted once fully shipped.
+type spool struct {
+	mu              sync.Mutex
+	dir             string
+	maxBytes        int64
+	segmentBytes    int64
+	overflowPolicy  OverflowPolicy
+	overflowTimeout time.Duration
+
+	writeSegment int
+	writeFile    *os.File
+	writeBytes   int64
+
+	readSegment int
+	readOffset  int64
+
+	totalBytes int64
+
+	shipFn    spoolShipFunc
+	onCorrupt spoolCorruptFunc
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// newSpool opens dir (creating it if necessary), resumes from any existing segments and cursor, and starts
+// the background shipper. onCorrupt, if non-nil, is notified when a frame fails its CRC check and is
+// skipped rather than retried.
+func newSpool(opts *FluentBitHandlerOptions, shipFn spoolShipFunc, onCorrupt spoolCorruptFunc) (*spool, error) {
+	if err := os.MkdirAll(opts.SpoolDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	segments, err := listSpoolSegments(opts.SpoolDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool segments: %w", err)
+	}
+
+	s := &spool{
+		dir:             opts.SpoolDir,
+		maxBytes:        opts.MaxSpoolBytes,
+		segmentBytes:    opts.SpoolSegmentBytes,
+		overflowPolicy:  opts.OverflowPolicy,
+		overflowTimeout: opts.OverflowTimeout,
+		shipFn:          shipFn,
+		onCorrupt:       onCorrupt,
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+
+	writeSegment := 0
+	if len(segments) > 0 {
+		writeSegment = segments[len(segments)-1]
+	}
+	if err := s.openWriteSegmentLocked(writeSegment); err != nil {
+		return nil, err
+	}
+	for _, idx := range segments {
+		if info, statErr := os.Stat(s.segmentPath(idx)); statErr == nil {
+			s.totalBytes += info.Size()
+		}
+	}
+
+	cursor, err := readSpoolCursor(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool cursor: %w", err)
+	}
+	s.readSegment = cursor.segment
+	s.readOffset = cursor.offset
+	// bytes before the cursor in the read segment were already delivered, so they don't count as pending
+	if info, statErr := os.Stat(s.segmentPath(cursor.segment)); statErr == nil && cursor.offset <= info.Size() {
+		s.totalBytes -= cursor.offset
+	}
+
+	go s.shipLoop()
+	return s, nil
+}
+
+// segmentPath returns the path of segment idx within the spool directory.
+func (s *spool) segmentPath(idx int) string {
+	return filepath.Join(s.dir, fmt.Sprintf(spoolSegmentPattern, idx))
+}
+
+// append writes payload to the spool as a new frame, applying the configured OverflowPolicy if MaxSpoolBytes
+// would otherwise be exceeded, rotating to a new segment if the current one has reached SpoolSegmentBytes.
+func (s *spool) append(ctx context.Context, payload []byte) error {
+	deadline := time.Now().Add(s.overflowTimeout)
+	frameSize := int64(spoolFrameSize(len(payload)))
+
+	s.mu.Lock()
+	for s.maxBytes > 0 && s.totalBytes+frameSize > s.maxBytes {
+		switch s.overflowPolicy {
+		case OverflowPolicyDropOldest:
+			dropped, err := s.dropOldestLocked()
+			if err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			if !dropped {
+				// nothing older can be dropped, so the incoming record is discarded instead
+				s.mu.Unlock()
+				return nil
+			}
+		case OverflowPolicyDropNewest:
+			s.mu.Unlock()
+			return nil
+		default: // OverflowPolicyBlockWithTimeout
+			s.mu.Unlock()
+			if !time.Now().Before(deadline) {
+				return ErrBufferOverflowTimeout
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(batchPollInterval):
+			}
+			s.mu.Lock()
+		}
+	}
+	defer s.mu.Unlock()
+
+	if s.segmentBytes > 0 && s.writeBytes >= s.segmentBytes {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	n, err := writeSpoolFrame(s.writeFile, payload)
+	if err != nil {
+		return err
+	}
+	s.writeBytes += int64(n)
+	s.totalBytes += int64(n)
+	return nil
+}
+
+// rotateLocked closes the current write segment and opens the next one. The caller must hold s.mu.
+func (s *spool) rotateLocked() error {
+	if s.writeFile != nil {
+		if err := s.writeFile.Close(); err != nil {
+			return err
+		}
+	}
+	return s.openWriteSegmentLocked(s.writeSegment + 1)
+}
+
+// openWriteSegmentLocked opens (creating if necessary) segment idx for appending. The caller must hold s.mu.
+func (s *spool) openWriteSegmentLocked(idx int) error {
+	f, err := os.OpenFile(s.segmentPath(idx), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.writeFile = f
+	s.writeSegment = idx
+	s.writeBytes = info.Size()
+	return nil
+}
+
+// dropOldestLocked discards the segment the shipper has not yet fully consumed, to make room for new
+// writes under OverflowPolicyDropOldest, and reports whether it dropped one. The caller must hold s.mu.
+func (s *spool) dropOldestLocked() (bool, error) {
+	if s.readSegment >= s.writeSegment {
+		// the only segment left is the one we're writing to; nothing safe to drop
+		return false, nil
+	}
+
+	dropped := int64(0)
+	if info, err := os.Stat(s.segmentPath(s.readSegment)); err == nil {
+		dropped = info.Size() - s.readOffset
+	}
+	if err := os.Remove(s.segmentPath(s.readSegment)); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	s.totalBytes -= dropped
+	s.readSegment++
+	s.readOffset = 0
+	return true, writeSpoolCursor(s.dir, spoolCursor{segment: s.readSegment, offset: 0})
+}
+
+// shipLoop periodically ships every currently-available frame until told to stop.
+func (s *spool) shipLoop() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(spoolShipInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			for s.shipNext(context.Background()) {
+			}
+			return
+		case <-ticker.C:
+			for s.shipNext(context.Background()) {
+			}
+		}
+	}
+}
+
+// shipNext ships the next unshipped frame, if any, and reports whether it made progress (shipped a frame or
+// rolled over to the next segment) so the caller can keep draining without waiting for the next tick.
+func (s *spool) shipNext(ctx context.Context) bool {
+	s.mu.Lock()
+	readSegment, readOffset := s.readSegment, s.readOffset
+	s.mu.Unlock()
+
+	f, err := os.Open(s.segmentPath(readSegment))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(readOffset, io.SeekStart); err != nil {
+		return false
+	}
+
+	payload, frameLen, err := readSpoolFrame(f)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			s.mu.Lock()
+			rolled := s.rollReadSegmentLocked(readSegment)
+			s.mu.Unlock()
+			return rolled
+		}
+		if errors.Is(err, errSpoolFrameCorrupt) {
+			// a torn or corrupted frame would otherwise wedge every record behind it forever; skip past
+			// it and surface the loss instead of stalling silently
+			if s.onCorrupt != nil {
+				s.onCorrupt(readSegment, readOffset, err)
+			}
+			s.mu.Lock()
+			s.readOffset = readOffset + int64(frameLen)
+			s.totalBytes -= int64(frameLen)
+			_ = writeSpoolCursor(s.dir, spoolCursor{segment: s.readSegment, offset: s.readOffset})
+			s.mu.Unlock()
+			return true
+		}
+		return false
+	}
+
+	if err := s.shipFn(ctx, payload); err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readOffset = readOffset + int64(frameLen)
+	s.totalBytes -= int64(frameLen)
+	_ = writeSpoolCursor(s.dir, spoolCursor{segment: s.readSegment, offset: s.readOffset})
+	return true
+}
+
+// rollReadSegmentLocked advances past segment, which has been fully read, deleting it and moving on to the
+// next one if a newer segment is already being written to. The caller must hold s.mu.
+func (s *spool) rollReadSegmentLocked(segment int) bool {
+	if segment >= s.writeSegment {
+		return false
+	}
+	_ = os.Remove(s.segmentPath(segment))
+	s.readSegment = segment + 1
+	s.readOffset = 0
+	_ = writeSpoolCursor(s.dir, spoolCursor{segment: s.readSegment, offset: 0})
+	return true
+}
+
+// shutdown stops the shipper and closes the current write segment, respecting ctx as a bound on how long
+// the shipper is given for its final pass, which ships every frame it can before stopping.
+func (s *spool) shutdown(ctx context.Context) error {
+	close(s.done)
+	select {
+	case <-s.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeFile != nil {
+		return s.writeFile.Close()
+	}
+	return nil
+}
+
+// spoolFrameSize returns the on-disk size of a frame carrying a payload of payloadLen bytes: a 4-byte
+// length, the payload itself, and a 4-byte CRC32.
+func spoolFrameSize(payloadLen int) int {
+	return 4 + payloadLen + 4
+}
+
+// writeSpoolFrame writes a length-prefixed, CRC32-checked frame for payload to w.
+func writeSpoolFrame(w io.Writer, payload []byte) (int, error) {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	written := 0
+
+	n, err := w.Write(header[:])
+	written += n
+	if err != nil {
+		return written, err
+	}
+
+	n, err = w.Write(payload)
+	written += n
+	if err != nil {
+		return written, err
+	}
+
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(payload))
+	n, err = w.Write(crc[:])
+	written += n
+	return written, err
+}
+
+// readSpoolFrame reads and verifies a single frame from r, returning the payload and the total number of
+// bytes the frame occupied on disk. A missing frame is reported as io.EOF and one only partially written
+// (e.g. because the process crashed mid-write) as io.ErrUnexpectedEOF, so the caller treats either as
+// "nothing more to ship yet" rather than as corruption.
+func readSpoolFrame(r io.Reader) ([]byte, int, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	var crcBytes [4]byte
+	if _, err := io.ReadFull(r, crcBytes[:]); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	frameLen := spoolFrameSize(len(payload))
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(crcBytes[:]) {
+		// the frame was read in full (so frameLen is trustworthy), it just doesn't check out; let the
+		// caller skip past it rather than treating it like a not-yet-complete write
+		return nil, frameLen, errSpoolFrameCorrupt
+	}
+	return payload, frameLen, nil
+}
+
+// listSpoolSegments returns the segment indices present in dir, sorted in ascending order.
+func listSpoolSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []int
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".log") {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".log"))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, idx)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+// readSpoolCursor reads the cursor file from dir, returning a zero-value spoolCursor if it doesn't exist
+// yet (a fresh spool).
+func readSpoolCursor(dir string) (spoolCursor, error) {
+	data, err := os.ReadFile(filepath.Join(dir, spoolCursorFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return spoolCursor{}, nil
+	}
+	if err != nil {
+		return spoolCursor{}, err
+	}
+
+	var c spoolCursor
+	if _, err := fmt.Sscanf(string(data), "%d %d", &c.segment, &c.offset); err != nil {
+		return spoolCursor{}, fmt.Errorf("malformed spool cursor: %w", err)
+	}
+	return c, nil
+}
+
+// writeSpoolCursor atomically persists cursor to dir.
+func writeSpoolCursor(dir string, cursor spoolCursor) error {
+	path := filepath.Join(dir, spoolCursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", cursor.segment, cursor.offset)), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
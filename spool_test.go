@@ -0,0 +1,162 @@
+package slogxfluentbit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingShipFn returns a spoolShipFunc that appends every delivered payload to shipped, guarded by mu,
+// and a func to read back what was shipped so far.
+func recordingShipFn() (spoolShipFunc, func() []string) {
+	var mu sync.Mutex
+	var shipped []string
+	fn := func(ctx context.Context, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		shipped = append(shipped, string(payload))
+		return nil
+	}
+	get := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		out := make([]string, len(shipped))
+		copy(out, shipped)
+		return out
+	}
+	return fn, get
+}
+
+func failingShipFn(ctx context.Context, payload []byte) error {
+	return errors.New("listener unreachable")
+}
+
+func testSpoolOptions(dir string) *FluentBitHandlerOptions {
+	return &FluentBitHandlerOptions{
+		SpoolDir:          dir,
+		SpoolSegmentBytes: 1 << 20,
+		OverflowPolicy:    OverflowPolicyBlockWithTimeout,
+		OverflowTimeout:   time.Second,
+	}
+}
+
+func TestSpoolResumesFromCursorAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	spA, err := newSpool(testSpoolOptions(dir), failingShipFn, nil)
+	if err != nil {
+		t.Fatalf("newSpool() error = %v", err)
+	}
+	if err := spA.append(ctx, []byte("one")); err != nil {
+		t.Fatalf("append(one) error = %v", err)
+	}
+	if err := spA.append(ctx, []byte("two")); err != nil {
+		t.Fatalf("append(two) error = %v", err)
+	}
+	// nothing gets shipped since failingShipFn never succeeds; the records must stay on disk
+	if err := spA.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	shipFn, shipped := recordingShipFn()
+	spB, err := newSpool(testSpoolOptions(dir), shipFn, nil)
+	if err != nil {
+		t.Fatalf("newSpool() (resumed) error = %v", err)
+	}
+	if err := spB.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown() (resumed) error = %v", err)
+	}
+
+	got := shipped()
+	want := []string{"one", "two"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("shipped records after restart = %v, want %v", got, want)
+	}
+}
+
+func TestSpoolSkipsCorruptFrameAndContinues(t *testing.T) {
+	dir := t.TempDir()
+
+	var goodFrame bytes.Buffer
+	if _, err := writeSpoolFrame(&goodFrame, []byte("good2")); err != nil {
+		t.Fatalf("writeSpoolFrame() error = %v", err)
+	}
+
+	var corruptFrame bytes.Buffer
+	if _, err := writeSpoolFrame(&corruptFrame, []byte("corrupt1")); err != nil {
+		t.Fatalf("writeSpoolFrame() error = %v", err)
+	}
+	corrupted := corruptFrame.Bytes()
+	corrupted[len(corrupted)-1] ^= 0xFF // flip a bit in the trailing CRC32
+
+	segmentPath := filepath.Join(dir, "000000.log")
+	var segment bytes.Buffer
+	segment.Write(corrupted)
+	segment.Write(goodFrame.Bytes())
+	if err := os.WriteFile(segmentPath, segment.Bytes(), 0o600); err != nil {
+		t.Fatalf("failed to seed segment file: %v", err)
+	}
+
+	var corruptMu sync.Mutex
+	var corruptEvents []string
+	onCorrupt := func(segmentIdx int, offset int64, err error) {
+		corruptMu.Lock()
+		defer corruptMu.Unlock()
+		corruptEvents = append(corruptEvents, err.Error())
+	}
+
+	shipFn, shipped := recordingShipFn()
+	sp, err := newSpool(testSpoolOptions(dir), shipFn, onCorrupt)
+	if err != nil {
+		t.Fatalf("newSpool() error = %v", err)
+	}
+	if err := sp.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	got := shipped()
+	if len(got) != 1 || got[0] != "good2" {
+		t.Fatalf("shipped records = %v, want only the frame after the corrupt one", got)
+	}
+
+	corruptMu.Lock()
+	defer corruptMu.Unlock()
+	if len(corruptEvents) != 1 {
+		t.Fatalf("onCorrupt called %d times, want 1", len(corruptEvents))
+	}
+}
+
+func TestSpoolTreatsTruncatedTrailingFrameAsNotYetWritten(t *testing.T) {
+	dir := t.TempDir()
+
+	var frame bytes.Buffer
+	if _, err := writeSpoolFrame(&frame, []byte("complete")); err != nil {
+		t.Fatalf("writeSpoolFrame() error = %v", err)
+	}
+	full := frame.Bytes()
+	truncated := full[:len(full)-2] // simulate a crash mid-write of the trailing CRC
+
+	segmentPath := filepath.Join(dir, "000000.log")
+	if err := os.WriteFile(segmentPath, truncated, 0o600); err != nil {
+		t.Fatalf("failed to seed segment file: %v", err)
+	}
+
+	shipFn, shipped := recordingShipFn()
+	sp, err := newSpool(testSpoolOptions(dir), shipFn, nil)
+	if err != nil {
+		t.Fatalf("newSpool() error = %v", err)
+	}
+	if err := sp.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	if got := shipped(); len(got) != 0 {
+		t.Fatalf("shipped records = %v, want none for a torn trailing frame", got)
+	}
+}